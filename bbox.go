@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// bboxCellSize is the edge length of the coarse grid cells used to find
+// connected regions of change before the tight per-pixel bounding box of
+// each region is computed.
+const bboxCellSize = 16
+
+// bboxRegion is one changed rectangle recorded in a .DIFF.<ext>.json manifest.
+type bboxRegion struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	W     int    `json:"w"`
+	H     int    `json:"h"`
+	Image string `json:"image"`
+}
+
+// bboxManifest is the sidecar JSON written next to a set of bbox crop PNGs,
+// recording the base frame's dimensions (so applyBBoxDiff can validate it
+// against the running reconstruction) and every changed region.
+type bboxManifest struct {
+	BaseWidth  int          `json:"base_width"`
+	BaseHeight int          `json:"base_height"`
+	Regions    []bboxRegion `json:"regions"`
+}
+
+// writeBBoxDiff finds the disjoint regions of currentImg that changed
+// relative to baseImg and writes each as a small cropped PNG next to
+// currentPath, plus a .DIFF.<ext>.json manifest recording their offsets. Returns
+// the number of regions written.
+func writeBBoxDiff(fs FileSystem, baseImg, currentImg image.Image, currentPath string, threshold float64) (int, error) {
+	regions := findChangedRegions(baseImg, currentImg, threshold)
+	bounds := baseImg.Bounds()
+
+	manifest := bboxManifest{BaseWidth: bounds.Dx(), BaseHeight: bounds.Dy()}
+	for i, rect := range regions {
+		regionPath, err := bboxRegionPath(currentPath, i)
+		if err != nil {
+			return 0, fmt.Errorf("failed to generate bbox region filename for %s: %w", currentPath, err)
+		}
+
+		f, err := fs.Create(regionPath)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create bbox region file %s: %w", regionPath, err)
+		}
+		err = png.Encode(f, cropImage(currentImg, rect))
+		f.Close()
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode bbox region to PNG %s: %w", regionPath, err)
+		}
+
+		manifest.Regions = append(manifest.Regions, bboxRegion{
+			X: rect.Min.X, Y: rect.Min.Y, W: rect.Dx(), H: rect.Dy(),
+			Image: filepath.Base(regionPath),
+		})
+	}
+
+	manifestPath, err := bboxManifestPath(currentPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate bbox manifest filename for %s: %w", currentPath, err)
+	}
+	manifestFile, err := fs.Create(manifestPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create bbox manifest file %s: %w", manifestPath, err)
+	}
+	defer manifestFile.Close()
+
+	enc := json.NewEncoder(manifestFile)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return 0, fmt.Errorf("failed to write bbox manifest %s: %w", manifestPath, err)
+	}
+
+	return len(regions), nil
+}
+
+// applyBBoxDiff reconstructs a frame by starting from baseImg and blitting
+// each region recorded in the manifest at manifestPath onto it. Dimension
+// checks are against "does this sub-rect fit inside the base bounds"
+// rather than requiring equal bounds, since a bbox diff only ever covers
+// part of the frame.
+func applyBBoxDiff(fs FileSystem, baseImg image.Image, manifestPath string) (*image.RGBA, error) {
+	manifestFile, err := fs.Open(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bbox manifest %s: %w", manifestPath, err)
+	}
+	defer manifestFile.Close()
+
+	var manifest bboxManifest
+	if err := json.NewDecoder(manifestFile).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse bbox manifest %s: %w", manifestPath, err)
+	}
+
+	baseBounds := baseImg.Bounds()
+	if manifest.BaseWidth != baseBounds.Dx() || manifest.BaseHeight != baseBounds.Dy() {
+		return nil, fmt.Errorf("bbox manifest %s dimensions (%dx%d) do not match base image (%dx%d)",
+			manifestPath, manifest.BaseWidth, manifest.BaseHeight, baseBounds.Dx(), baseBounds.Dy())
+	}
+
+	reconstructed := image.NewRGBA(baseBounds)
+	draw.Draw(reconstructed, baseBounds, baseImg, baseBounds.Min, draw.Src)
+
+	dir := filepath.Dir(manifestPath)
+	for _, region := range manifest.Regions {
+		rect := image.Rect(region.X, region.Y, region.X+region.W, region.Y+region.H)
+		if !rect.In(baseBounds) {
+			return nil, fmt.Errorf("bbox region %+v does not fit within base bounds %s", region, baseBounds)
+		}
+
+		regionPath := filepath.Join(dir, region.Image)
+		regionImg, err := loadImage(fs, regionPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load bbox region %s: %w", regionPath, err)
+		}
+		draw.Draw(reconstructed, rect, regionImg, regionImg.Bounds().Min, draw.Src)
+	}
+
+	return reconstructed, nil
+}
+
+// findChangedRegions locates the disjoint rectangles of change between
+// baseImg and currentImg: a coarse grid is scanned for cells containing any
+// pixel whose color distance exceeds threshold, connected changed cells are
+// grouped with a flood fill, and each group's tight pixel bounding box is
+// computed. This keeps a moving cursor and a status bar, say, as two small
+// crops instead of one full-frame diff.
+func findChangedRegions(baseImg, currentImg image.Image, threshold float64) []image.Rectangle {
+	bounds := baseImg.Bounds()
+	cols := (bounds.Dx() + bboxCellSize - 1) / bboxCellSize
+	rows := (bounds.Dy() + bboxCellSize - 1) / bboxCellSize
+	if cols == 0 || rows == 0 {
+		return nil
+	}
+
+	changed := make([][]bool, rows)
+	for r := range changed {
+		changed[r] = make([]bool, cols)
+		for c := range changed[r] {
+			cellRect := tileBounds(bounds, bboxCellSize, c, r)
+			changed[r][c] = cellHasChange(baseImg, currentImg, cellRect, threshold)
+		}
+	}
+
+	visited := make([][]bool, rows)
+	for r := range visited {
+		visited[r] = make([]bool, cols)
+	}
+
+	var regions []image.Rectangle
+	for r := range rows {
+		for c := range cols {
+			if !changed[r][c] || visited[r][c] {
+				continue
+			}
+			cells := floodFillCells(changed, visited, r, c)
+			regions = append(regions, tightPixelBounds(baseImg, currentImg, bounds, cells, threshold))
+		}
+	}
+	return regions
+}
+
+func cellHasChange(baseImg, currentImg image.Image, rect image.Rectangle, threshold float64) bool {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c1 := color.RGBAModel.Convert(baseImg.At(x, y)).(color.RGBA)
+			c2 := color.RGBAModel.Convert(currentImg.At(x, y)).(color.RGBA)
+			if colorDistance(c1, c2) > threshold {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type cellCoord struct{ row, col int }
+
+// floodFillCells returns every changed, not-yet-visited cell reachable from
+// (startRow, startCol) via 4-connectivity, marking them visited as it goes.
+func floodFillCells(changed, visited [][]bool, startRow, startCol int) []cellCoord {
+	rows, cols := len(changed), len(changed[0])
+	queue := []cellCoord{{startRow, startCol}}
+	visited[startRow][startCol] = true
+
+	var region []cellCoord
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		region = append(region, cur)
+
+		for _, n := range [...]cellCoord{
+			{cur.row - 1, cur.col}, {cur.row + 1, cur.col},
+			{cur.row, cur.col - 1}, {cur.row, cur.col + 1},
+		} {
+			if n.row < 0 || n.row >= rows || n.col < 0 || n.col >= cols {
+				continue
+			}
+			if visited[n.row][n.col] || !changed[n.row][n.col] {
+				continue
+			}
+			visited[n.row][n.col] = true
+			queue = append(queue, n)
+		}
+	}
+	return region
+}
+
+// tightPixelBounds scans only the pixels within cells and returns the
+// smallest rectangle containing every pixel that actually changed.
+func tightPixelBounds(baseImg, currentImg image.Image, bounds image.Rectangle, cells []cellCoord, threshold float64) image.Rectangle {
+	minX, minY := math.MaxInt, math.MaxInt
+	maxX, maxY := math.MinInt, math.MinInt
+
+	for _, cell := range cells {
+		rect := tileBounds(bounds, bboxCellSize, cell.col, cell.row)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				c1 := color.RGBAModel.Convert(baseImg.At(x, y)).(color.RGBA)
+				c2 := color.RGBAModel.Convert(currentImg.At(x, y)).(color.RGBA)
+				if colorDistance(c1, c2) > threshold {
+					minX, minY = min(minX, x), min(minY, y)
+					maxX, maxY = max(maxX, x+1), max(maxY, y+1)
+				}
+			}
+		}
+	}
+	return image.Rect(minX, minY, maxX, maxY)
+}
+
+// cropImage returns a new RGBA image holding img's real pixels (alpha
+// included) within rect, re-based at (0, 0).
+func cropImage(img image.Image, rect image.Rectangle) *image.RGBA {
+	cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			cropped.Set(x-rect.Min.X, y-rect.Min.Y, c)
+		}
+	}
+	return cropped
+}
+
+// bboxRegionPath derives the path for the i-th changed-region crop of
+// currentPath's diff, e.g. "frame2.png" with index 0 -> "frame2.DIFF.0.png".
+func bboxRegionPath(currentPath string, index int) (string, error) {
+	name, err := generateOutputFilename(currentPath, "DIFF")
+	if err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(name, ext), index, ext), nil
+}
+
+// bboxManifestPath derives the manifest sidecar path for currentPath's diff,
+// keeping the original extension in the name (rather than replacing it)
+// so bboxOriginalPath can recover it later instead of assuming PNG, e.g.
+// "frame2.jpg" -> "frame2.DIFF.jpg.json".
+func bboxManifestPath(currentPath string) (string, error) {
+	name, err := generateOutputFilename(currentPath, "DIFF")
+	if err != nil {
+		return "", err
+	}
+	return name + ".json", nil
+}
+
+// bboxOriginalPath is the inverse of bboxManifestPath.
+func bboxOriginalPath(manifestPath string) (string, error) {
+	const suffix = ".json"
+	base := filepath.Base(manifestPath)
+	if !strings.HasSuffix(base, suffix) {
+		return "", fmt.Errorf("expected a %s file, got %s", suffix, manifestPath)
+	}
+	name := strings.TrimSuffix(base, suffix)
+	return generateOriginalFilename(filepath.Join(filepath.Dir(manifestPath), name))
+}
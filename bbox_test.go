@@ -0,0 +1,76 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestBBoxDiffRoundTrip(t *testing.T) {
+	fs := newMemFS()
+	base := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	cur := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := range 16 {
+		for x := range 16 {
+			base.Set(x, y, color.RGBA{5, 5, 5, 255})
+			cur.Set(x, y, color.RGBA{5, 5, 5, 255})
+		}
+	}
+	for y := 2; y < 5; y++ {
+		for x := 2; x < 5; x++ {
+			cur.Set(x, y, color.RGBA{250, 0, 0, 255})
+		}
+	}
+
+	regions, err := writeBBoxDiff(fs, base, cur, "frame.png", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if regions != 1 {
+		t.Fatalf("regions = %d, want 1", regions)
+	}
+
+	reconstructed, err := applyBBoxDiff(fs, base, "frame.DIFF.png.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reconstructed.RGBAAt(3, 3) != cur.RGBAAt(3, 3) {
+		t.Fatal("changed region not reconstructed correctly")
+	}
+	if reconstructed.RGBAAt(10, 10) != base.RGBAAt(10, 10) {
+		t.Fatal("unchanged region should match base")
+	}
+}
+
+func TestApplyBBoxDiffRejectsDimensionMismatch(t *testing.T) {
+	fs := newMemFS()
+	base := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	other := image.NewRGBA(image.Rect(0, 0, 8, 8))
+
+	if _, err := writeBBoxDiff(fs, base, other, "frame.png", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	wrongBase := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	if _, err := applyBBoxDiff(fs, wrongBase, "frame.DIFF.png.json"); err == nil {
+		t.Fatal("expected a dimension mismatch error, got nil")
+	}
+}
+
+func TestBBoxManifestPathPreservesNonPNGExtension(t *testing.T) {
+	manifestPath, err := bboxManifestPath("frames/frame2.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifestPath != "frames/frame2.DIFF.jpg.json" {
+		t.Fatalf("bboxManifestPath = %q, want %q", manifestPath, "frames/frame2.DIFF.jpg.json")
+	}
+
+	original, err := bboxOriginalPath(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original != "frames/frame2.jpg" {
+		t.Fatalf("bboxOriginalPath = %q, want %q", original, "frames/frame2.jpg")
+	}
+}
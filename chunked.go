@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultTileSize is the nominal tile edge length used by the chunked diff
+// format; the final row/column of tiles may be smaller where the frame
+// doesn't divide evenly.
+const defaultTileSize = 64
+
+const (
+	chunkedMagic         = "DCNK"
+	chunkedFormatVersion = 1
+	chunkedHeaderSize    = len(chunkedMagic) + 1 + 4 + 4 + 4 // magic + version + tileSize + width + height
+)
+
+// chunkedHeader is the fixed-size header at the start of every chunked diff
+// file, recording enough to reconstruct the tile grid without the TOC.
+type chunkedHeader struct {
+	TileSize uint32
+	Width    uint32
+	Height   uint32
+}
+
+// tocEntry describes one stored (changed) tile within a chunked diff file.
+type tocEntry struct {
+	TileIndex       uint32
+	Offset          uint64
+	CompressedLen   uint32
+	UncompressedLen uint32
+	SHA256          [32]byte
+}
+
+// encodeChunkedDiff writes a chunked, zstd-compressed binary diff of currImg
+// relative to prevImg to outPath. Frames are divided into tileSize x
+// tileSize tiles; only tiles whose pixels actually changed are stored, each
+// as an independently zstd-compressed blob, preceded by a header and
+// followed by a table of contents so a reader can seek straight to the
+// tiles it needs. Returns the number of changed tiles.
+func encodeChunkedDiff(fs FileSystem, prevImg, currImg image.Image, outPath string, tileSize int) (int, error) {
+	bounds := currImg.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	cols := (width + tileSize - 1) / tileSize
+	rows := (height + tileSize - 1) / tileSize
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+	defer enc.Close()
+
+	f, err := fs.Create(outPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create chunked diff file %s: %w", outPath, err)
+	}
+	defer f.Close()
+
+	if err := writeChunkedHeader(f, tileSize, width, height); err != nil {
+		return 0, fmt.Errorf("failed to write chunked header to %s: %w", outPath, err)
+	}
+
+	offset := uint64(chunkedHeaderSize)
+	var toc []tocEntry
+	for ty := range rows {
+		for tx := range cols {
+			tileIndex := uint32(ty*cols + tx)
+			rect := tileBounds(bounds, tileSize, tx, ty)
+			curBytes := extractTileBytes(currImg, rect)
+
+			if prevImg != nil && bytes.Equal(extractTileBytes(prevImg, rect), curBytes) {
+				continue // unchanged: the reader copies it from the previous reconstruction
+			}
+
+			compressed := enc.EncodeAll(curBytes, nil)
+			if _, err := f.Write(compressed); err != nil {
+				return 0, fmt.Errorf("failed to write tile %d to %s: %w", tileIndex, outPath, err)
+			}
+			toc = append(toc, tocEntry{
+				TileIndex:       tileIndex,
+				Offset:          offset,
+				CompressedLen:   uint32(len(compressed)),
+				UncompressedLen: uint32(len(curBytes)),
+				SHA256:          sha256.Sum256(curBytes),
+			})
+			offset += uint64(len(compressed))
+		}
+	}
+
+	tocOffset := offset
+	if err := writeTOC(f, toc); err != nil {
+		return 0, fmt.Errorf("failed to write chunked TOC to %s: %w", outPath, err)
+	}
+	if err := binary.Write(f, binary.BigEndian, tocOffset); err != nil {
+		return 0, fmt.Errorf("failed to write chunked footer to %s: %w", outPath, err)
+	}
+
+	return len(toc), nil
+}
+
+// applyChunkedDiff reconstructs a frame from a chunked diff file: changed
+// tiles are read from their TOC offset and decompressed, while unchanged
+// tiles are copied verbatim from prevImg, so only the tiles that actually
+// changed are ever decompressed.
+func applyChunkedDiff(fs FileSystem, prevImg image.Image, diffPath string) (*image.RGBA, error) {
+	f, err := fs.Open(diffPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chunked diff %s: %w", diffPath, err)
+	}
+	defer f.Close()
+
+	header, err := readChunkedHeader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunked header from %s: %w", diffPath, err)
+	}
+
+	if _, err := f.Seek(-8, io.SeekEnd); err != nil {
+		return nil, fmt.Errorf("failed to seek to chunked footer in %s: %w", diffPath, err)
+	}
+	var tocOffset uint64
+	if err := binary.Read(f, binary.BigEndian, &tocOffset); err != nil {
+		return nil, fmt.Errorf("failed to read chunked footer in %s: %w", diffPath, err)
+	}
+
+	if _, err := f.Seek(int64(tocOffset), io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek to chunked TOC in %s: %w", diffPath, err)
+	}
+	toc, err := readTOC(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunked TOC from %s: %w", diffPath, err)
+	}
+	byIndex := make(map[uint32]tocEntry, len(toc))
+	for _, e := range toc {
+		byIndex[e.TileIndex] = e
+	}
+
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+	defer dec.Close()
+
+	bounds := image.Rect(0, 0, int(header.Width), int(header.Height))
+	reconstructed := image.NewRGBA(bounds)
+	tileSize := int(header.TileSize)
+	cols := (bounds.Dx() + tileSize - 1) / tileSize
+	rows := (bounds.Dy() + tileSize - 1) / tileSize
+
+	for ty := range rows {
+		for tx := range cols {
+			tileIndex := uint32(ty*cols + tx)
+			rect := tileBounds(bounds, tileSize, tx, ty)
+
+			entry, changed := byIndex[tileIndex]
+			var tileBytes []byte
+			switch {
+			case changed:
+				if _, err := f.Seek(int64(entry.Offset), io.SeekStart); err != nil {
+					return nil, fmt.Errorf("failed to seek to tile %d in %s: %w", tileIndex, diffPath, err)
+				}
+				compressed := make([]byte, entry.CompressedLen)
+				if _, err := io.ReadFull(f, compressed); err != nil {
+					return nil, fmt.Errorf("failed to read tile %d from %s: %w", tileIndex, diffPath, err)
+				}
+				tileBytes, err = dec.DecodeAll(compressed, make([]byte, 0, entry.UncompressedLen))
+				if err != nil {
+					return nil, fmt.Errorf("failed to decompress tile %d from %s: %w", tileIndex, diffPath, err)
+				}
+				if sha256.Sum256(tileBytes) != entry.SHA256 {
+					return nil, fmt.Errorf("tile %d in %s failed checksum verification", tileIndex, diffPath)
+				}
+			case prevImg != nil:
+				tileBytes = extractTileBytes(prevImg, rect)
+			default:
+				return nil, fmt.Errorf("tile %d in %s is unchanged but there is no previous frame to copy it from", tileIndex, diffPath)
+			}
+
+			writeTileBytes(reconstructed, rect, tileBytes)
+		}
+	}
+
+	return reconstructed, nil
+}
+
+func writeChunkedHeader(w io.Writer, tileSize, width, height int) error {
+	if _, err := w.Write([]byte(chunkedMagic)); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{chunkedFormatVersion}); err != nil {
+		return err
+	}
+	for _, v := range []uint32{uint32(tileSize), uint32(width), uint32(height)} {
+		if err := binary.Write(w, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readChunkedHeader(r io.Reader) (chunkedHeader, error) {
+	magic := make([]byte, len(chunkedMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return chunkedHeader{}, err
+	}
+	if string(magic) != chunkedMagic {
+		return chunkedHeader{}, fmt.Errorf("not a chunked diff file (bad magic %q)", magic)
+	}
+
+	version := make([]byte, 1)
+	if _, err := io.ReadFull(r, version); err != nil {
+		return chunkedHeader{}, err
+	}
+	if version[0] != chunkedFormatVersion {
+		return chunkedHeader{}, fmt.Errorf("unsupported chunked format version %d", version[0])
+	}
+
+	var h chunkedHeader
+	for _, v := range []*uint32{&h.TileSize, &h.Width, &h.Height} {
+		if err := binary.Read(r, binary.BigEndian, v); err != nil {
+			return chunkedHeader{}, err
+		}
+	}
+	return h, nil
+}
+
+func writeTOC(w io.Writer, toc []tocEntry) error {
+	if err := binary.Write(w, binary.BigEndian, uint32(len(toc))); err != nil {
+		return err
+	}
+	for _, e := range toc {
+		if err := binary.Write(w, binary.BigEndian, e.TileIndex); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, e.Offset); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, e.CompressedLen); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.BigEndian, e.UncompressedLen); err != nil {
+			return err
+		}
+		if _, err := w.Write(e.SHA256[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readTOC(r io.Reader) ([]tocEntry, error) {
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, err
+	}
+
+	toc := make([]tocEntry, count)
+	for i := range toc {
+		if err := binary.Read(r, binary.BigEndian, &toc[i].TileIndex); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		if err := binary.Read(r, binary.BigEndian, &toc[i].Offset); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		if err := binary.Read(r, binary.BigEndian, &toc[i].CompressedLen); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		if err := binary.Read(r, binary.BigEndian, &toc[i].UncompressedLen); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		if _, err := io.ReadFull(r, toc[i].SHA256[:]); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+	}
+	return toc, nil
+}
+
+// tileBounds returns the clipped bounds of tile (tx, ty) within bounds,
+// given the nominal (un-clipped) tileSize.
+func tileBounds(bounds image.Rectangle, tileSize, tx, ty int) image.Rectangle {
+	x0 := bounds.Min.X + tx*tileSize
+	y0 := bounds.Min.Y + ty*tileSize
+	x1 := min(x0+tileSize, bounds.Max.X)
+	y1 := min(y0+tileSize, bounds.Max.Y)
+	return image.Rect(x0, y0, x1, y1)
+}
+
+// extractTileBytes serializes the RGBA pixels of img within rect into a flat
+// row-major byte slice, 4 bytes per pixel.
+func extractTileBytes(img image.Image, rect image.Rectangle) []byte {
+	out := make([]byte, 0, rect.Dx()*rect.Dy()*4)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			out = append(out, c.R, c.G, c.B, c.A)
+		}
+	}
+	return out
+}
+
+// writeTileBytes is the inverse of extractTileBytes: it blits a flat
+// row-major RGBA byte slice into img at rect.
+func writeTileBytes(img *image.RGBA, rect image.Rectangle, data []byte) {
+	i := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			img.Set(x, y, color.RGBA{R: data[i], G: data[i+1], B: data[i+2], A: data[i+3]})
+			i += 4
+		}
+	}
+}
+
+// chunkedDiffPath derives the chunked diff sidecar path for currentPath,
+// mirroring generateOutputFilename's "DIFF" suffix convention with a
+// ".chunked" suffix appended on top, e.g. "frame2.jpg" -> "frame2.DIFF.jpg.chunked".
+// Keeping the original extension in the name (rather than replacing it) lets
+// chunkedOriginalPath recover it later instead of assuming PNG.
+func chunkedDiffPath(currentPath string) string {
+	name, _ := generateOutputFilename(currentPath, "DIFF")
+	return name + ".chunked"
+}
+
+// chunkedOriginalPath is the inverse of chunkedDiffPath.
+func chunkedOriginalPath(diffPath string) (string, error) {
+	const suffix = ".chunked"
+	base := filepath.Base(diffPath)
+	if !strings.HasSuffix(base, suffix) {
+		return "", fmt.Errorf("expected a %s file, got %s", suffix, diffPath)
+	}
+	name := strings.TrimSuffix(base, suffix)
+	return generateOriginalFilename(filepath.Join(filepath.Dir(diffPath), name))
+}
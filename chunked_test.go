@@ -0,0 +1,69 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestChunkedDiffRoundTrip(t *testing.T) {
+	fs := newMemFS()
+	prev := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	cur := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := range 8 {
+		for x := range 8 {
+			prev.Set(x, y, color.RGBA{10, 10, 10, 255})
+			cur.Set(x, y, color.RGBA{10, 10, 10, 255})
+		}
+	}
+	cur.Set(1, 1, color.RGBA{200, 0, 0, 255}) // change inside the first 4x4 tile
+
+	changed, err := encodeChunkedDiff(fs, prev, cur, "out.DIFF.chunked", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed != 1 {
+		t.Fatalf("changedTiles = %d, want 1", changed)
+	}
+
+	got, err := applyChunkedDiff(fs, prev, "out.DIFF.chunked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RGBAAt(1, 1) != cur.RGBAAt(1, 1) {
+		t.Fatal("reconstructed changed pixel mismatch")
+	}
+	if got.RGBAAt(6, 6) != cur.RGBAAt(6, 6) {
+		t.Fatal("reconstructed unchanged pixel mismatch")
+	}
+}
+
+func TestChunkedDiffPathRoundTrip(t *testing.T) {
+	diffPath := chunkedDiffPath("frames/frame2.png")
+	if diffPath != "frames/frame2.DIFF.png.chunked" {
+		t.Fatalf("chunkedDiffPath = %q, want %q", diffPath, "frames/frame2.DIFF.png.chunked")
+	}
+
+	original, err := chunkedOriginalPath(diffPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original != "frames/frame2.png" {
+		t.Fatalf("chunkedOriginalPath = %q, want %q", original, "frames/frame2.png")
+	}
+}
+
+func TestChunkedDiffPathPreservesNonPNGExtension(t *testing.T) {
+	diffPath := chunkedDiffPath("frames/frame2.jpg")
+	if diffPath != "frames/frame2.DIFF.jpg.chunked" {
+		t.Fatalf("chunkedDiffPath = %q, want %q", diffPath, "frames/frame2.DIFF.jpg.chunked")
+	}
+
+	original, err := chunkedOriginalPath(diffPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original != "frames/frame2.jpg" {
+		t.Fatalf("chunkedOriginalPath = %q, want %q", original, "frames/frame2.jpg")
+	}
+}
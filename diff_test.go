@@ -0,0 +1,72 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCreateDiffImageRespectsThreshold(t *testing.T) {
+	base := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	cur := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	base.Set(0, 0, color.RGBA{100, 100, 100, 255})
+	cur.Set(0, 0, color.RGBA{102, 100, 100, 255}) // within tolerance
+	base.Set(1, 0, color.RGBA{100, 100, 100, 255})
+	cur.Set(1, 0, color.RGBA{200, 100, 100, 255}) // changed
+
+	_, mask, count := createDiffImage(base, cur, 5)
+	if count != 1 {
+		t.Fatalf("diffPixels = %d, want 1", count)
+	}
+	if mask.GrayAt(0, 0).Y != 0 {
+		t.Fatal("pixel within tolerance marked changed in mask")
+	}
+	if mask.GrayAt(1, 0).Y != 255 {
+		t.Fatal("changed pixel not marked in mask")
+	}
+}
+
+func TestSaveLoadMaskRoundTrip(t *testing.T) {
+	fs := newMemFS()
+	mask := image.NewGray(image.Rect(0, 0, 2, 2))
+	mask.SetGray(0, 0, color.Gray{Y: 255})
+
+	if err := saveMask(fs, "out.MASK.png", mask); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadMask(fs, "out.MASK.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GrayAt(0, 0).Y != 255 || got.GrayAt(1, 1).Y != 0 {
+		t.Fatal("mask round-trip mismatch")
+	}
+}
+
+func TestLoadMaskMissingFileIsNotAnError(t *testing.T) {
+	fs := newMemFS()
+	mask, err := loadMask(fs, "missing.MASK.png")
+	if err != nil {
+		t.Fatalf("loadMask on missing file returned an error: %v", err)
+	}
+	if mask != nil {
+		t.Fatal("loadMask on missing file should return a nil mask")
+	}
+}
+
+func TestApplyDiffPreservesBasePixelsOutsideMask(t *testing.T) {
+	base := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	base.Set(0, 0, color.RGBA{10, 20, 30, 128})
+	diffImg := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	diffImg.Set(0, 0, color.RGBA{1, 2, 3, 4})
+	mask := image.NewGray(image.Rect(0, 0, 1, 1)) // all zero: nothing changed
+
+	out, err := applyDiff(base, diffImg, mask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := color.RGBA{10, 20, 30, 128}
+	if got := out.RGBAAt(0, 0); got != want {
+		t.Fatalf("applyDiff = %+v, want %+v", got, want)
+	}
+}
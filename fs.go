@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ReadSeekCloser is a readable, seekable, closeable file handle. The chunked
+// diff format needs to seek to its trailing table of contents without
+// scanning the whole file, so FileSystem.Open returns this instead of a
+// plain io.ReadCloser.
+type ReadSeekCloser interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// FileSystem abstracts the filesystem operations differ needs, modeled on
+// afero.Fs, so the tool can be pointed at an in-memory filesystem in tests
+// instead of always hitting the real disk.
+type FileSystem interface {
+	Open(name string) (ReadSeekCloser, error)
+	Create(name string) (io.WriteCloser, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(dirname string) ([]os.DirEntry, error)
+}
+
+// osFS is the default FileSystem, backed by the real operating system.
+type osFS struct{}
+
+func (osFS) Open(name string) (ReadSeekCloser, error) { return os.Open(name) }
+
+func (osFS) Create(name string) (io.WriteCloser, error) { return os.Create(name) }
+
+func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+func (osFS) ReadDir(dirname string) ([]os.DirEntry, error) { return os.ReadDir(dirname) }
+
+// supportedExtensions are the file extensions (without a leading dot) differ
+// knows how to decode today. Keep this in sync with the blank decoder
+// imports at the top of main.go as new formats are registered.
+var supportedExtensions = []string{"jpg", "jpeg", "png", "gif"}
+
+// expandInputs turns CLI arguments -- explicit files, directories, or glob
+// patterns -- into a flat list of file paths. Directories are walked in
+// sorted order (recursively if recursive is true) and glob patterns are
+// expanded through FileSystem via globFS, so the whole resolution pipeline
+// -- not just Stat/ReadDir -- can be driven against an in-memory FileSystem
+// in tests; both are filtered by exts and skip differ's own output files,
+// so re-running -diff -recursive (or with a glob argument) over a directory
+// it already wrote into doesn't ingest that output as new input frames.
+// Explicit file arguments are passed through untouched, preserving the
+// order the caller gave them.
+func expandInputs(fs FileSystem, args []string, recursive bool, exts []string) ([]string, error) {
+	allowed := make(map[string]bool, len(exts))
+	for _, e := range exts {
+		e = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(e, ".")))
+		if e != "" {
+			allowed[e] = true
+		}
+	}
+
+	var out []string
+	for _, arg := range args {
+		info, err := fs.Stat(arg)
+		switch {
+		case err == nil && info.IsDir():
+			files, walkErr := walkDir(fs, arg, recursive, allowed)
+			if walkErr != nil {
+				return nil, walkErr
+			}
+			out = append(out, files...)
+		case strings.ContainsAny(arg, "*?["):
+			matches, globErr := globFS(fs, arg)
+			if globErr != nil {
+				return nil, fmt.Errorf("invalid glob pattern %q: %w", arg, globErr)
+			}
+			sort.Strings(matches)
+			for _, m := range matches {
+				ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(m), "."))
+				if allowed[ext] && !isGeneratedOutput(filepath.Base(m)) {
+					out = append(out, m)
+				}
+			}
+		default:
+			out = append(out, arg)
+		}
+	}
+	return out, nil
+}
+
+// isGeneratedOutput reports whether name looks like one of differ's own
+// output files: the BASE copy, a PNG+mask diff (.DIFF./.MASK.), a chunked
+// diff (.DIFF.<ext>.chunked), or a bbox crop/manifest (.DIFF.<n>.<ext>/.DIFF.<ext>.json).
+// All of those put ".BASE.", ".DIFF.", or ".MASK." somewhere in the
+// filename, so checking for those substrings covers every format without
+// needing to know which one produced a given file.
+func isGeneratedOutput(name string) bool {
+	return strings.Contains(name, ".BASE.") || strings.Contains(name, ".DIFF.") || strings.Contains(name, ".MASK.")
+}
+
+// walkDir lists the files directly under dir (or, if recursive, under the
+// whole subtree) whose extension is in allowed, skipping differ's own
+// output files, in sorted order.
+func walkDir(fs FileSystem, dir string, recursive bool, allowed map[string]bool) ([]string, error) {
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var out []string
+	for _, entry := range entries {
+		full := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if recursive {
+				sub, err := walkDir(fs, full, recursive, allowed)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, sub...)
+			}
+			continue
+		}
+		if isGeneratedOutput(entry.Name()) {
+			continue
+		}
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(entry.Name()), "."))
+		if allowed[ext] {
+			out = append(out, full)
+		}
+	}
+	return out, nil
+}
+
+// globFS resolves pattern against fs, mirroring the shape of filepath.Glob
+// but routed entirely through FileSystem.Stat/ReadDir instead of the real
+// filesystem. It handles the glob patterns differ actually takes as input:
+// a literal or itself-glob directory prefix, resolved recursively, followed
+// by one pattern segment, e.g. "frames/*.png" or "captures/*/*.png".
+func globFS(fs FileSystem, pattern string) ([]string, error) {
+	dir, file := filepath.Split(pattern)
+	dir = strings.TrimSuffix(dir, string(filepath.Separator))
+
+	if !hasMeta(dir) && !hasMeta(file) {
+		if _, err := fs.Stat(pattern); err != nil {
+			return nil, nil
+		}
+		return []string{pattern}, nil
+	}
+
+	var dirs []string
+	switch {
+	case dir == "":
+		dirs = []string{""}
+	case hasMeta(dir):
+		var err error
+		dirs, err = globFS(fs, dir)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		dirs = []string{dir}
+	}
+
+	var matches []string
+	for _, d := range dirs {
+		lookupDir := d
+		if lookupDir == "" {
+			lookupDir = "."
+		}
+		info, err := fs.Stat(lookupDir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		entries, err := fs.ReadDir(lookupDir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			matched, err := filepath.Match(file, entry.Name())
+			if err != nil {
+				return nil, err
+			}
+			if matched {
+				matches = append(matches, filepath.Join(d, entry.Name()))
+			}
+		}
+	}
+	return matches, nil
+}
+
+// hasMeta reports whether s contains any glob meta characters.
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
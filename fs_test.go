@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestExpandInputsSkipsGeneratedOutput(t *testing.T) {
+	fs := newMemFS()
+	fs.files["frames/a.png"] = []byte("a")
+	fs.files["frames/b.png"] = []byte("b")
+	fs.files["frames/a.BASE.png"] = []byte("base")
+	fs.files["frames/b.DIFF.png"] = []byte("diff")
+	fs.files["frames/b.MASK.png"] = []byte("mask")
+
+	got, err := expandInputs(fs, []string{"frames"}, false, supportedExtensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"frames/a.png", "frames/b.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expandInputs = %v, want %v", got, want)
+	}
+}
+
+func TestExpandInputsGlobGoesThroughFileSystem(t *testing.T) {
+	fs := newMemFS()
+	fs.files["frames/a.png"] = []byte("a")
+	fs.files["frames/b.png"] = []byte("b")
+	fs.files["frames/c.txt"] = []byte("c")
+
+	got, err := globFS(fs, "frames/*.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := []string{"frames/a.png", "frames/b.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("globFS = %v, want %v", got, want)
+	}
+}
+
+func TestExpandInputsGlobSkipsGeneratedOutput(t *testing.T) {
+	fs := newMemFS()
+	fs.files["frames/a.png"] = []byte("a")
+	fs.files["frames/b.png"] = []byte("b")
+	fs.files["frames/a.BASE.png"] = []byte("base")
+	fs.files["frames/b.DIFF.png"] = []byte("diff")
+	fs.files["frames/b.MASK.png"] = []byte("mask")
+
+	got, err := expandInputs(fs, []string{"frames/*.png"}, false, supportedExtensions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := []string{"frames/a.png", "frames/b.png"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expandInputs(glob) = %v, want %v", got, want)
+	}
+}
+
+func TestIsGeneratedOutput(t *testing.T) {
+	cases := map[string]bool{
+		"frame.png":          false,
+		"frame.BASE.png":     true,
+		"frame.DIFF.png":     true,
+		"frame.MASK.png":     true,
+		"frame.DIFF.chunked": true,
+		"frame.DIFF.0.png":   true,
+		"frame.DIFF.json":    true,
+	}
+	for name, want := range cases {
+		if got := isGeneratedOutput(name); got != want {
+			t.Errorf("isGeneratedOutput(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
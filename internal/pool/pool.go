@@ -0,0 +1,91 @@
+// Package pool provides a bounded worker pool used to run per-item work
+// (decoding a frame, diffing a pair, encoding a diff) across a fixed number
+// of goroutines, instead of spawning one goroutine per item.
+package pool
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Pool is a bounded worker pool that runs submitted tasks across a fixed
+// number of goroutines and, when given a unit, reports progress to stderr
+// as tasks complete. It is reused across modes and pipeline stages: one
+// submits one task per image pair, another submits image-decode tasks so
+// later frames can be decoded while earlier ones are still being processed.
+type Pool struct {
+	tasks chan func()
+	wg    sync.WaitGroup
+
+	mu    sync.Mutex
+	done  int
+	total int
+	unit  string
+	start time.Time
+}
+
+// New creates a Pool with the given number of workers and starts them
+// immediately. If workers <= 0, runtime.NumCPU() is used. total and unit
+// are only used to format the progress line (e.g. total=10, unit="pairs"
+// prints "3/10 pairs"); pass unit "" to suppress progress output entirely,
+// for a stage that shouldn't talk over another stage's progress line.
+func New(workers, total int, unit string) *Pool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	p := &Pool{
+		tasks: make(chan func()),
+		total: total,
+		unit:  unit,
+		start: time.Now(),
+	}
+	for range workers {
+		go p.worker()
+	}
+	return p
+}
+
+func (p *Pool) worker() {
+	for task := range p.tasks {
+		task()
+	}
+}
+
+// Submit queues a task to run on the pool, blocking until a worker picks it
+// up. Each submitted task counts as one unit toward the progress total.
+func (p *Pool) Submit(task func()) {
+	p.wg.Add(1)
+	p.tasks <- func() {
+		defer p.wg.Done()
+		defer p.reportProgress()
+		task()
+	}
+}
+
+func (p *Pool) reportProgress() {
+	if p.unit == "" {
+		return
+	}
+
+	p.mu.Lock()
+	p.done++
+	done := p.done
+	p.mu.Unlock()
+
+	elapsed := time.Since(p.start).Round(time.Second)
+	fmt.Fprintf(os.Stderr, "\rProcessed %d/%d %s (%s elapsed)", done, p.total, p.unit, elapsed)
+}
+
+// Wait blocks until all submitted tasks have completed and shuts the pool
+// down. The pool must not be reused after Wait returns.
+func (p *Pool) Wait() {
+	p.wg.Wait()
+	close(p.tasks)
+	if p.unit != "" {
+		fmt.Fprintln(os.Stderr)
+	}
+}
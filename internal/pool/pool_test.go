@@ -0,0 +1,48 @@
+package pool
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolBoundsConcurrency(t *testing.T) {
+	const workers = 3
+	p := New(workers, 10, "")
+
+	var cur, maxSeen int32
+	var mu sync.Mutex
+	for range 10 {
+		p.Submit(func() {
+			n := atomic.AddInt32(&cur, 1)
+			mu.Lock()
+			if n > maxSeen {
+				maxSeen = n
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&cur, -1)
+		})
+	}
+	p.Wait()
+
+	if maxSeen > workers {
+		t.Fatalf("pool ran %d tasks concurrently, want <= %d", maxSeen, workers)
+	}
+	if maxSeen < 1 {
+		t.Fatal("pool never ran a task")
+	}
+}
+
+func TestPoolZeroWorkersFallsBackToNumCPU(t *testing.T) {
+	p := New(0, 1, "")
+
+	var ran bool
+	p.Submit(func() { ran = true })
+	p.Wait()
+
+	if !ran {
+		t.Fatal("task submitted to a zero-worker pool never ran")
+	}
+}
@@ -1,24 +1,30 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/png"
 	"io"
+	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
 	"strings"
-	"sync"
+
+	"github.com/Delnegend/differ/internal/pool"
 
 	_ "image/gif"
 	_ "image/jpeg"
 )
 
-// loadImage opens and decodes an image file.
-func loadImage(filePath string) (image.Image, error) {
-	file, err := os.Open(filePath)
+// loadImage opens and decodes an image file through fs.
+func loadImage(fs FileSystem, filePath string) (image.Image, error) {
+	file, err := fs.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open image %s: %w", filePath, err)
 	}
@@ -88,15 +94,15 @@ func generateOriginalFilename(inputPath string) (string, error) {
 	return filepath.Join(dir, originalFullName), nil
 }
 
-// copyFile copies a file from src to dst.
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
+// copyFile copies a file from src to dst through fs.
+func copyFile(fs FileSystem, src, dst string) error {
+	sourceFile, err := fs.Open(src)
 	if err != nil {
 		return fmt.Errorf("failed to open source file %s: %w", src, err)
 	}
 	defer sourceFile.Close()
 
-	destFile, err := os.Create(dst)
+	destFile, err := fs.Create(dst)
 	if err != nil {
 		return fmt.Errorf("failed to create destination file %s: %w", dst, err)
 	}
@@ -106,15 +112,32 @@ func copyFile(src, dst string) error {
 	if err != nil {
 		return fmt.Errorf("failed to copy file from %s to %s: %w", src, dst, err)
 	}
-	return destFile.Sync() // Ensure data is written to stable storage
+	if syncer, ok := destFile.(interface{ Sync() error }); ok {
+		return syncer.Sync() // Ensure data is written to stable storage
+	}
+	return nil
+}
+
+// colorDistance returns the Euclidean distance between two colors' R/G/B
+// channels, used as a simple perceptual tolerance metric for -threshold.
+func colorDistance(c1, c2 color.RGBA) float64 {
+	dr := float64(c1.R) - float64(c2.R)
+	dg := float64(c1.G) - float64(c2.G)
+	db := float64(c1.B) - float64(c2.B)
+	return math.Sqrt(dr*dr + dg*dg + db*db)
 }
 
-// createDiffImage compares two images and returns an RGBA image holding the differences.
-func createDiffImage(baseImg, currentImg image.Image) (*image.RGBA, int) {
+// createDiffImage compares two images and returns an RGBA image holding the
+// current image's real colors (alpha untouched) at every changed pixel, plus
+// a separate grayscale mask marking which pixels changed. A pixel counts as
+// changed only if its color distance exceeds threshold, so lossy re-encodes
+// within tolerance no longer produce spurious diffs. Keeping the mask out of
+// the diff image's own alpha channel means genuine alpha is preserved.
+func createDiffImage(baseImg, currentImg image.Image, threshold float64) (diffImg *image.RGBA, mask *image.Gray, diffPixels int) {
 	bounds := baseImg.Bounds() // Assumes dimensions are already checked
-	diffImg := image.NewRGBA(bounds)
+	diffImg = image.NewRGBA(bounds)
+	mask = image.NewGray(bounds)
 	width, height := bounds.Dx(), bounds.Dy()
-	diffPixels := 0
 
 	for y := range height {
 		for x := range width {
@@ -122,68 +145,88 @@ func createDiffImage(baseImg, currentImg image.Image) (*image.RGBA, int) {
 			c1 := color.RGBAModel.Convert(baseImg.At(absX, absY)).(color.RGBA)
 			c2 := color.RGBAModel.Convert(currentImg.At(absX, absY)).(color.RGBA)
 
-			if c1.R != c2.R || c1.G != c2.G || c1.B != c2.B {
-				diffImg.Set(absX, absY, color.RGBA{R: c2.R, G: c2.G, B: c2.B, A: 255})
+			if colorDistance(c1, c2) > threshold {
+				diffImg.Set(absX, absY, c2)
+				mask.SetGray(absX, absY, color.Gray{Y: 255})
 				diffPixels++
 			}
 		}
 	}
-	return diffImg, diffPixels
+	return diffImg, mask, diffPixels
 }
 
-// processPair compares two images, creates a diff image, and saves it next to the current image.
-// Designed to be run in a goroutine.
-func processPair(wg *sync.WaitGroup, prevImg image.Image, currentImg image.Image, prevPath, currentPath string) {
-	defer wg.Done() // Signal completion when this function returns
+// maskFormatVersion is written as the first byte of every mask sidecar file,
+// so a future change to the mask encoding can be detected and old and new
+// diffs can coexist on disk.
+const maskFormatVersion byte = 1
 
-	fmt.Printf("Processing pair: %s vs %s\n", prevPath, currentPath)
-
-	// Check dimensions
-	bounds1 := prevImg.Bounds()
-	bounds2 := currentImg.Bounds()
-	if bounds1 != bounds2 {
-		fmt.Fprintf(os.Stderr, "Error: Image dimensions do not match (%s vs %s) for pair (%s, %s). Skipping.\n",
-			bounds1, bounds2, prevPath, currentPath)
-		return
+// saveMask writes mask to path as a version byte followed by a PNG encoding
+// of the grayscale changed-pixel mask (255 = changed, 0 = unchanged).
+func saveMask(fs FileSystem, path string, mask *image.Gray) error {
+	f, err := fs.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create mask file %s: %w", path, err)
 	}
+	defer f.Close()
 
-	// Create difference image
-	diffImg, diffPixels := createDiffImage(prevImg, currentImg)
-	fmt.Printf("Found %d different pixels between %s and %s.\n", diffPixels, prevPath, currentPath)
+	if _, err := f.Write([]byte{maskFormatVersion}); err != nil {
+		return fmt.Errorf("failed to write mask header to %s: %w", path, err)
+	}
+	if err := png.Encode(f, mask); err != nil {
+		return fmt.Errorf("failed to encode mask to PNG %s: %w", path, err)
+	}
+	return nil
+}
 
-	// Generate output filename for the *current* image's diff, placing it in the same directory
-	diffOutputName, err := generateOutputFilename(currentPath, "DIFF")
+// loadMask reads a mask sidecar file written by saveMask. A missing file is
+// not an error: it simply means this diff predates the mask format, and the
+// caller should fall back to the legacy alpha-as-mask behavior.
+func loadMask(fs FileSystem, path string) (*image.Gray, error) {
+	f, err := fs.Open(path)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating diff filename for %s: %v. Skipping save.\n", currentPath, err)
-		return
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open mask file %s: %w", path, err)
 	}
+	defer f.Close()
 
-	// Save the difference image
-	outFile, err := os.Create(diffOutputName)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create output file %s: %v\n", diffOutputName, err)
-		return // Return on error
+	header := make([]byte, 1)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, fmt.Errorf("failed to read mask header from %s: %w", path, err)
+	}
+	if header[0] != maskFormatVersion {
+		return nil, fmt.Errorf("unsupported mask format version %d in %s", header[0], path)
 	}
-	defer outFile.Close() // Ensure file is closed even on encode error
 
-	err = png.Encode(outFile, diffImg)
+	img, _, err := image.Decode(f)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to encode difference image to PNG %s: %v\n", diffOutputName, err)
-		// File will be closed by defer
-	} else {
-		fmt.Printf("Difference image saved to %s\n", diffOutputName)
+		return nil, fmt.Errorf("failed to decode mask PNG %s: %w", path, err)
+	}
+	if gray, ok := img.(*image.Gray); ok {
+		return gray, nil
 	}
+	bounds := img.Bounds()
+	gray := image.NewGray(bounds)
+	draw.Draw(gray, bounds, img, bounds.Min, draw.Src)
+	return gray, nil
 }
 
-// applyDiff combines a base image and a diff image (where diff pixels overwrite base).
+// applyDiff combines a base image and a diff image. Pixels the mask marks as
+// changed take the diff image's color; everything else keeps the base
+// image's color. If mask is nil (no sidecar file, i.e. a pre-mask diff),
+// falls back to treating any diff pixel with non-zero alpha as changed.
 // Returns the newly reconstructed image.
-func applyDiff(baseImg, diffImg image.Image) (*image.RGBA, error) {
+func applyDiff(baseImg, diffImg image.Image, mask *image.Gray) (*image.RGBA, error) {
 	boundsBase := baseImg.Bounds()
 	boundsDiff := diffImg.Bounds()
 
 	if boundsBase != boundsDiff {
 		return nil, fmt.Errorf("dimensions mismatch between base (%s) and diff (%s)", boundsBase, boundsDiff)
 	}
+	if mask != nil && mask.Bounds() != boundsBase {
+		return nil, fmt.Errorf("dimensions mismatch between base (%s) and mask (%s)", boundsBase, mask.Bounds())
+	}
 
 	reconstructed := image.NewRGBA(boundsBase)
 	width, height := boundsBase.Dx(), boundsBase.Dy()
@@ -194,8 +237,14 @@ func applyDiff(baseImg, diffImg image.Image) (*image.RGBA, error) {
 
 			diffPixelColor := color.RGBAModel.Convert(diffImg.At(absX, absY)).(color.RGBA)
 
-			// If the diff pixel has non-zero alpha, use its color. Otherwise, use the base image color.
-			if diffPixelColor.A > 0 {
+			var changed bool
+			if mask != nil {
+				changed = mask.GrayAt(absX, absY).Y > 0
+			} else {
+				changed = diffPixelColor.A > 0
+			}
+
+			if changed {
 				reconstructed.Set(absX, absY, diffPixelColor)
 			} else {
 				basePixelColor := color.RGBAModel.Convert(baseImg.At(absX, absY))
@@ -206,75 +255,59 @@ func applyDiff(baseImg, diffImg image.Image) (*image.RGBA, error) {
 	return reconstructed, nil
 }
 
-// runDiffMode handles the logic for creating BASE and DIFF files concurrently.
-func runDiffMode(inputFiles []string) {
+// runDiffMode handles the logic for creating BASE and DIFF files. Pairs are
+// run through an explicit three-stage pipeline -- loadStage decodes frames,
+// diffStage computes their difference, encodeStage writes it to disk --
+// each stage a function returning its own channel and running its own
+// bounded worker set, so decoding of frame N+2 can overlap with diffing of
+// N/N+1 and encoding of N-1/N instead of the whole set living in memory at
+// once. jobs controls the number of workers per stage; if jobs <= 0,
+// runtime.NumCPU() is used. threshold is the per-pixel color distance
+// tolerance below which a pixel is considered unchanged. format selects the
+// on-disk diff representation ("png" or "chunked"); bbox requests
+// per-region crops instead of a full-frame diff when format is "png". ctx
+// lets a Ctrl-C abort in-flight work instead of leaking goroutines.
+func runDiffMode(ctx context.Context, fs FileSystem, inputFiles []string, jobs int, threshold float64, format string, bbox bool) {
 	if len(inputFiles) < 2 {
 		fmt.Fprintln(os.Stderr, "Error: -diff mode requires at least two input images.")
 		printUsage()
 		os.Exit(1)
 	}
 
-	// 1. Handle the first image (copy as BASE) - remains sequential
+	// Handle the first image (copy as BASE) - remains sequential.
 	firstImagePath := inputFiles[0]
 	baseOutputName, err := generateOutputFilename(firstImagePath, "BASE") // Pass full path
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error generating base filename for %s: %v\n", firstImagePath, err)
 		os.Exit(1)
 	}
-	err = copyFile(firstImagePath, baseOutputName) // Use full output path
+	err = copyFile(fs, firstImagePath, baseOutputName) // Use full output path
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error copying base image %s to %s: %v\n", firstImagePath, baseOutputName, err)
 		os.Exit(1)
 	}
 	fmt.Printf("Copied base image %s to %s\n", firstImagePath, baseOutputName)
 
-	// 2. Process consecutive pairs for differences concurrently
-	var wg sync.WaitGroup // Initialize WaitGroup
-
-	var prevImage image.Image // Store the previously loaded image
-	prevImage, err = loadImage(firstImagePath)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err) // loadImage already includes path info
-		os.Exit(1)                   // Exit if the very first image fails to load
-	}
-	prevImagePath := firstImagePath
-
-	for i := 1; i < len(inputFiles); i++ {
-		currentImagePath := inputFiles[i]
+	pairs := loadStage(ctx, fs, inputFiles, jobs)
+	diffs := diffStage(ctx, pairs, jobs, threshold, format, bbox)
+	results := encodeStage(ctx, fs, diffs, jobs, len(inputFiles)-1, threshold, format, bbox)
 
-		// Load current image sequentially
-		currentImage, err := loadImage(currentImagePath)
+	fmt.Println("\nWaiting for image processing tasks to complete...")
+	for err := range results {
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			fmt.Fprintf(os.Stderr, "Skipping comparisons involving %s due to load error.\n", currentImagePath)
-			prevImage = nil
-			prevImagePath = ""
-			continue
-		}
-
-		// If the previous image was loaded successfully, process the pair
-		if prevImage != nil {
-			wg.Add(1) // Increment counter before launching goroutine
-			// processPair now handles generating the correct output path based on currentPath
-			go processPair(&wg, prevImage, currentImage, prevImagePath, currentImagePath)
-		} else {
-			fmt.Fprintf(os.Stderr, "Skipping comparison for %s as previous image %s failed to load or process.\n", currentImagePath, prevImagePath)
 		}
-
-		// Update prevImage and prevImagePath for the *next* iteration's comparison
-		prevImage = currentImage
-		prevImagePath = currentImagePath
 	}
 
-	// Wait for all launched goroutines to complete
-	fmt.Println("\nWaiting for image processing tasks to complete...")
-	wg.Wait()
-
 	fmt.Println("\nDiff processing complete.")
 }
 
 // runJoinMode handles the logic for reconstructing images sequentially.
-func runJoinMode(inputFiles []string) {
+// Decoding of the next DIFF file is overlapped with applying the current
+// one via a shared worker pool, even though reconstruction itself must
+// stay strictly in order. format and bbox must match whatever -diff used to
+// produce the input files.
+func runJoinMode(fs FileSystem, inputFiles []string, jobs int, format string, bbox bool) {
 	if len(inputFiles) < 2 {
 		fmt.Fprintln(os.Stderr, "Error: -join mode requires at least two input images (base + diffs).")
 		printUsage()
@@ -288,7 +321,7 @@ func runJoinMode(inputFiles []string) {
 	}
 
 	// Load the initial base image
-	currentReconstructedImage, err := loadImage(baseImagePath)
+	currentReconstructedImage, err := loadImage(fs, baseImagePath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load base image %s: %v\n", baseImagePath, err)
 		os.Exit(1)
@@ -301,7 +334,7 @@ func runJoinMode(inputFiles []string) {
 		os.Exit(1) // Cannot proceed without a valid name
 	}
 
-	outFileBase, err := os.Create(originalBaseName) // Use full output path
+	outFileBase, err := fs.Create(originalBaseName) // Use full output path
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to create output file %s: %v\n", originalBaseName, err)
 		os.Exit(1)
@@ -316,7 +349,37 @@ func runJoinMode(inputFiles []string) {
 	}
 	fmt.Printf("Saved reconstructed base image: %s\n", originalBaseName)
 
-	// Process subsequent DIFF files sequentially
+	if format == "chunked" {
+		runJoinModeChunked(fs, inputFiles, currentReconstructedImage)
+		fmt.Println("\nJoin processing complete.")
+		return
+	}
+	if bbox {
+		runJoinModeBBox(fs, inputFiles, currentReconstructedImage)
+		fmt.Println("\nJoin processing complete.")
+		return
+	}
+
+	// Process subsequent DIFF files sequentially, but decode them ahead of
+	// time on the pool so decoding of diff N+1 overlaps with applying diff N.
+	type decodeResult struct {
+		img image.Image
+		err error
+	}
+	decoded := make([]chan decodeResult, len(inputFiles))
+	for i := range decoded {
+		decoded[i] = make(chan decodeResult, 1)
+	}
+
+	decoders := pool.New(jobs, len(inputFiles)-1, "frames")
+	decode := func(i int) {
+		decoders.Submit(func() {
+			img, err := loadImage(fs, inputFiles[i])
+			decoded[i] <- decodeResult{img: img, err: err}
+		})
+	}
+	decode(1)
+
 	for i := 1; i < len(inputFiles); i++ {
 		diffImagePath := inputFiles[i]
 		if !strings.Contains(filepath.Base(diffImagePath), ".DIFF.") {
@@ -324,14 +387,28 @@ func runJoinMode(inputFiles []string) {
 		}
 		fmt.Printf("\nApplying diff: %s\n", diffImagePath)
 
-		diffImage, err := loadImage(diffImagePath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to load diff image %s: %v. Stopping reconstruction.\n", diffImagePath, err)
+		// Kick off decoding of the next diff file before waiting on this one.
+		if i+1 < len(inputFiles) {
+			decode(i + 1)
+		}
+
+		result := <-decoded[i]
+		if result.err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load diff image %s: %v. Stopping reconstruction.\n", diffImagePath, result.err)
 			os.Exit(1) // Cannot continue sequence if a diff is missing/corrupt
 		}
+		diffImage := result.img
+
+		// Load the companion mask, if one was written alongside this diff.
+		maskPath := strings.Replace(diffImagePath, ".DIFF.", ".MASK.", 1)
+		mask, err := loadMask(fs, maskPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load mask %s: %v. Stopping reconstruction.\n", maskPath, err)
+			os.Exit(1)
+		}
 
 		// Apply the diff to the last reconstructed image
-		newReconstructedImage, err := applyDiff(currentReconstructedImage, diffImage)
+		newReconstructedImage, err := applyDiff(currentReconstructedImage, diffImage, mask)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to apply diff %s: %v. Stopping reconstruction.\n", diffImagePath, err)
 			os.Exit(1)
@@ -345,7 +422,7 @@ func runJoinMode(inputFiles []string) {
 		}
 
 		// Save the new reconstructed image
-		outFileDiff, err := os.Create(originalDiffName) // Use full output path
+		outFileDiff, err := fs.Create(originalDiffName) // Use full output path
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to create output file %s: %v\n", originalDiffName, err)
 			os.Exit(1)
@@ -361,10 +438,88 @@ func runJoinMode(inputFiles []string) {
 		// Update the current reconstructed image for the next iteration
 		currentReconstructedImage = newReconstructedImage
 	}
+	decoders.Wait()
 
 	fmt.Println("\nJoin processing complete.")
 }
 
+// runJoinModeChunked reconstructs images from a base frame plus a sequence
+// of chunked diff files. Unlike the PNG+mask path, each chunked diff already
+// knows which tiles to copy from the previous reconstruction, so there's no
+// separate mask lookup or decode-ahead pipeline.
+func runJoinModeChunked(fs FileSystem, inputFiles []string, baseImg image.Image) {
+	current := baseImg
+	for i := 1; i < len(inputFiles); i++ {
+		diffPath := inputFiles[i]
+		fmt.Printf("\nApplying chunked diff: %s\n", diffPath)
+
+		reconstructed, err := applyChunkedDiff(fs, current, diffPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to apply chunked diff %s: %v. Stopping reconstruction.\n", diffPath, err)
+			os.Exit(1)
+		}
+
+		originalName, err := chunkedOriginalPath(diffPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to generate original filename for %s: %v\n", diffPath, err)
+			os.Exit(1)
+		}
+
+		outFile, err := fs.Create(originalName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create output file %s: %v\n", originalName, err)
+			os.Exit(1)
+		}
+		err = png.Encode(outFile, reconstructed)
+		outFile.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save reconstructed image %s: %v\n", originalName, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved reconstructed image: %s\n", originalName)
+
+		current = reconstructed
+	}
+}
+
+// runJoinModeBBox reconstructs images from a base frame plus a sequence of
+// bbox .DIFF.<ext>.json manifests, each blitting its recorded regions onto the
+// running reconstruction.
+func runJoinModeBBox(fs FileSystem, inputFiles []string, baseImg image.Image) {
+	current := baseImg
+	for i := 1; i < len(inputFiles); i++ {
+		manifestPath := inputFiles[i]
+		fmt.Printf("\nApplying bbox diff: %s\n", manifestPath)
+
+		reconstructed, err := applyBBoxDiff(fs, current, manifestPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to apply bbox diff %s: %v. Stopping reconstruction.\n", manifestPath, err)
+			os.Exit(1)
+		}
+
+		originalName, err := bboxOriginalPath(manifestPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to generate original filename for %s: %v\n", manifestPath, err)
+			os.Exit(1)
+		}
+
+		outFile, err := fs.Create(originalName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create output file %s: %v\n", originalName, err)
+			os.Exit(1)
+		}
+		err = png.Encode(outFile, reconstructed)
+		outFile.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save reconstructed image %s: %v\n", originalName, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved reconstructed image: %s\n", originalName)
+
+		current = reconstructed
+	}
+}
+
 func printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  differ -diff <image1> <image2> [image3 ...]")
@@ -374,6 +529,8 @@ func printUsage() {
 	fmt.Println("    Reconstructs original images from base and difference files.")
 	fmt.Println("    Input: image1.BASE.png image2.DIFF.png image3.DIFF.png ...")
 	fmt.Println("    Output: image1.png, image2.png, image3.png, ...")
+	fmt.Println("\n  Arguments may also be directories or glob patterns (e.g. frames/*.png")
+	fmt.Println("  or a whole capture directory with -recursive).")
 	fmt.Println("\nFlags:")
 	flag.PrintDefaults() // Print default flag values (like -diff=false)
 }
@@ -381,6 +538,12 @@ func printUsage() {
 func main() {
 	diffMode := flag.Bool("diff", false, "Generate difference files (BASE + DIFFs)")
 	joinMode := flag.Bool("join", false, "Reconstruct images from BASE + DIFFs")
+	jobs := flag.Int("jobs", runtime.NumCPU(), "number of worker goroutines to use for processing")
+	recursive := flag.Bool("recursive", false, "Recurse into subdirectories of any directory argument")
+	extFlag := flag.String("ext", strings.Join(supportedExtensions, ","), "Comma-separated list of file extensions to pick up from directories/globs")
+	threshold := flag.Float64("threshold", 0, "Per-pixel color distance tolerance; changes below this are ignored (-diff only)")
+	format := flag.String("format", "png", "Diff container format: \"png\" (PNG + mask) or \"chunked\" (tiled, zstd-compressed binary)")
+	bbox := flag.Bool("bbox", false, "Emit small per-region crops plus a .DIFF.<ext>.json manifest instead of a full-frame diff (requires -format=png)")
 
 	flag.Parse()
 
@@ -390,15 +553,32 @@ func main() {
 		printUsage()
 		os.Exit(1)
 	}
+	if *format != "png" && *format != "chunked" {
+		fmt.Fprintf(os.Stderr, "Error: -format must be \"png\" or \"chunked\", got %q\n", *format)
+		printUsage()
+		os.Exit(1)
+	}
+	if *bbox && *format != "png" {
+		fmt.Fprintln(os.Stderr, "Error: -bbox requires -format=png")
+		printUsage()
+		os.Exit(1)
+	}
 
-	inputFiles := flag.Args()
+	fs := osFS{}
+	inputFiles, err := expandInputs(fs, flag.Args(), *recursive, strings.Split(*extFlag, ","))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving input files: %v\n", err)
+		os.Exit(1)
+	}
 
 	if *diffMode {
 		fmt.Println("Mode: Diff")
-		runDiffMode(inputFiles)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		runDiffMode(ctx, fs, inputFiles, *jobs, *threshold, *format, *bbox)
 	} else if *joinMode {
 		fmt.Println("Mode: Join")
-		runJoinMode(inputFiles)
+		runJoinMode(fs, inputFiles, *jobs, *format, *bbox)
 	}
 
 	fmt.Println("\nProcessing complete.") // This might be redundant now
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// memFS is a minimal in-memory FileSystem used by tests, so the whole input
+// resolution and diff/join pipeline can be driven without touching disk.
+type memFS struct {
+	files map[string][]byte
+}
+
+func newMemFS() *memFS { return &memFS{files: map[string][]byte{}} }
+
+func (m *memFS) Open(name string) (ReadSeekCloser, error) {
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return &memFile{Reader: bytes.NewReader(data)}, nil
+}
+
+type memFile struct {
+	*bytes.Reader
+}
+
+func (*memFile) Close() error { return nil }
+
+func (m *memFS) Create(name string) (io.WriteCloser, error) {
+	return &memWriteCloser{fs: m, name: name}, nil
+}
+
+type memWriteCloser struct {
+	fs   *memFS
+	name string
+	buf  bytes.Buffer
+}
+
+func (w *memWriteCloser) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+func (w *memWriteCloser) Close() error {
+	w.fs.files[w.name] = append([]byte(nil), w.buf.Bytes()...)
+	return nil
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	name = strings.TrimSuffix(name, "/")
+	if _, ok := m.files[name]; ok {
+		return memFileInfo{name: filepath.Base(name)}, nil
+	}
+	if m.isDir(name) {
+		return memFileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+func (m *memFS) isDir(name string) bool {
+	if name == "." || name == "" {
+		return true
+	}
+	prefix := name + "/"
+	for f := range m.files {
+		if strings.HasPrefix(f, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *memFS) ReadDir(dirname string) ([]os.DirEntry, error) {
+	dirname = strings.TrimSuffix(dirname, "/")
+	if dirname == "." {
+		dirname = ""
+	}
+	prefix := dirname
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	seen := map[string]bool{}
+	var entries []os.DirEntry
+	for f := range m.files {
+		if !strings.HasPrefix(f, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(f, prefix)
+		parts := strings.SplitN(rest, "/", 2)
+		name := parts[0]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		entries = append(entries, memDirEntry{name: name, dir: len(parts) > 1})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+type memFileInfo struct {
+	name string
+	dir  bool
+}
+
+func (i memFileInfo) Name() string { return i.name }
+func (i memFileInfo) Size() int64  { return 0 }
+func (i memFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir
+	}
+	return 0
+}
+func (i memFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memFileInfo) IsDir() bool        { return i.dir }
+func (i memFileInfo) Sys() any           { return nil }
+
+type memDirEntry struct {
+	name string
+	dir  bool
+}
+
+func (e memDirEntry) Name() string { return e.name }
+func (e memDirEntry) IsDir() bool  { return e.dir }
+func (e memDirEntry) Type() os.FileMode {
+	if e.dir {
+		return os.ModeDir
+	}
+	return 0
+}
+func (e memDirEntry) Info() (os.FileInfo, error) {
+	return memFileInfo{name: e.name, dir: e.dir}, nil
+}
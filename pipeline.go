@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"runtime"
+
+	"github.com/Delnegend/differ/internal/pool"
+)
+
+// framePair is one consecutive pair of decoded frames, emitted by loadStage
+// and consumed by diffStage.
+type framePair struct {
+	index                 int
+	prevPath, currentPath string
+	prevImg, currentImg   image.Image
+}
+
+// frameResult is the outcome of decoding a single frame.
+type frameResult struct {
+	img image.Image
+	err error
+}
+
+// diffJob is the output of diffStage and input to encodeStage. For the
+// default PNG format, diffImg/mask/diffPixels hold the already-computed
+// difference. For "chunked" and "bbox", which interleave diffing with their
+// own streaming/region-finding writers, prevImg/currentImg are carried
+// through unchanged and encodeStage does the diffing itself.
+type diffJob struct {
+	prevPath, currentPath string
+	prevImg, currentImg   image.Image
+	diffImg               *image.RGBA
+	mask                  *image.Gray
+	diffPixels            int
+	err                   error
+}
+
+// loadStage decodes paths with up to jobs workers running concurrently, and
+// emits one framePair per consecutive pair, in order. Decoding of frame
+// i+window only starts once the consumer reaches frame i, mirroring
+// runJoinMode's decode-ahead-by-one scheme in main.go (just with a wider,
+// jobs-sized window), so at most a small window of frames is ever
+// decoded-but-not-yet-consumed at once instead of the whole set sitting in
+// memory together. Progress is left to encodeStage, the pipeline's final
+// stage, so the two don't fight over the same terminal line. The returned
+// channel is closed once every pair has been emitted, paths is exhausted,
+// or ctx is cancelled.
+func loadStage(ctx context.Context, fs FileSystem, paths []string, jobs int) <-chan framePair {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	window := jobs
+	if window > len(paths) {
+		window = len(paths)
+	}
+
+	out := make(chan framePair)
+
+	results := make([]chan frameResult, len(paths))
+	for i := range results {
+		results[i] = make(chan frameResult, 1)
+	}
+
+	decoders := pool.New(jobs, len(paths), "")
+	decode := func(i int) {
+		decoders.Submit(func() {
+			img, err := loadImage(fs, paths[i])
+			results[i] <- frameResult{img: img, err: err}
+		})
+	}
+	for i := range window {
+		decode(i)
+	}
+
+	go func() {
+		defer close(out)
+		defer decoders.Wait()
+
+		var prevImg image.Image
+		var prevPath string
+		for i, p := range paths {
+			if next := i + window; next < len(paths) {
+				decode(next)
+			}
+
+			var res frameResult
+			select {
+			case res = <-results[i]:
+			case <-ctx.Done():
+				return
+			}
+
+			if res.err != nil {
+				fmt.Fprintln(os.Stderr, res.err)
+				fmt.Fprintf(os.Stderr, "Skipping comparisons involving %s due to load error.\n", p)
+				prevImg, prevPath = nil, ""
+				continue
+			}
+
+			switch {
+			case prevImg != nil:
+				pair := framePair{index: i, prevPath: prevPath, currentPath: p, prevImg: prevImg, currentImg: res.img}
+				select {
+				case out <- pair:
+				case <-ctx.Done():
+					return
+				}
+			case i > 0:
+				fmt.Fprintf(os.Stderr, "Skipping comparison for %s as previous image %s failed to load or process.\n", p, prevPath)
+			}
+
+			prevImg, prevPath = res.img, p
+		}
+	}()
+
+	return out
+}
+
+// diffStage computes the per-pair difference for the default PNG format, so
+// that work overlaps with decoding ahead of it and encoding behind it.
+// "chunked" and "bbox" compute their diff as part of writing it, so for
+// those formats diffStage only checks dimensions and passes the pair
+// through untouched; encodeStage does the real work. Up to jobs pairs are
+// diffed concurrently on an internal/pool.Pool, like loadStage and
+// encodeStage; progress is left to encodeStage, so unit is "". Each send to
+// out selects on ctx.Done() too, so a pair that finishes diffing after
+// encodeStage has already stopped reading (because ctx was cancelled)
+// doesn't block its worker forever.
+func diffStage(ctx context.Context, in <-chan framePair, jobs int, threshold float64, format string, bbox bool) <-chan diffJob {
+	out := make(chan diffJob)
+	differs := pool.New(jobs, 0, "")
+
+	go func() {
+		defer close(out)
+		defer differs.Wait()
+
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case pair, ok := <-in:
+				if !ok {
+					break loop
+				}
+				differs.Submit(func() {
+					select {
+					case out <- diffPair(pair, threshold, format, bbox):
+					case <-ctx.Done():
+					}
+				})
+			}
+		}
+	}()
+
+	return out
+}
+
+// diffPair checks that prev and current agree on dimensions and, for the
+// plain PNG format, computes their difference image and mask up front.
+func diffPair(pair framePair, threshold float64, format string, bbox bool) diffJob {
+	job := diffJob{
+		prevPath: pair.prevPath, currentPath: pair.currentPath,
+		prevImg: pair.prevImg, currentImg: pair.currentImg,
+	}
+
+	bounds1, bounds2 := pair.prevImg.Bounds(), pair.currentImg.Bounds()
+	if bounds1 != bounds2 {
+		job.err = fmt.Errorf("image dimensions do not match (%s vs %s) for pair (%s, %s). Skipping",
+			bounds1, bounds2, pair.prevPath, pair.currentPath)
+		return job
+	}
+
+	if format == "chunked" || bbox {
+		return job
+	}
+
+	job.diffImg, job.mask, job.diffPixels = createDiffImage(pair.prevImg, pair.currentImg, threshold)
+	return job
+}
+
+// encodeStage writes each diffJob to disk in the selected container format,
+// using up to jobs workers. As the pipeline's final stage, it alone reports
+// progress -- one "done/total pairs" tick per job -- so loadStage's and its
+// own progress lines don't interleave and garble each other on a terminal.
+// total is the number of pairs expected, used only to format that line. The
+// returned channel carries one error (nil on success) per job and is closed
+// once in is drained or ctx is cancelled.
+func encodeStage(ctx context.Context, fs FileSystem, in <-chan diffJob, jobs, total int, threshold float64, format string, bbox bool) <-chan error {
+	out := make(chan error)
+	encoders := pool.New(jobs, total, "pairs")
+
+	go func() {
+		defer close(out)
+
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case job, ok := <-in:
+				if !ok {
+					break loop
+				}
+				encoders.Submit(func() {
+					out <- encodeDiffJob(fs, job, threshold, format, bbox)
+				})
+			}
+		}
+		encoders.Wait()
+	}()
+
+	return out
+}
+
+// encodeDiffJob writes one diffJob to disk in the selected container format.
+// A job carrying an error from diffStage (e.g. a dimension mismatch) is
+// reported and skipped rather than treated as a pipeline failure.
+func encodeDiffJob(fs FileSystem, job diffJob, threshold float64, format string, bbox bool) error {
+	if job.err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", job.err)
+		return nil
+	}
+
+	fmt.Printf("Processing pair: %s vs %s\n", job.prevPath, job.currentPath)
+
+	if format == "chunked" {
+		outPath := chunkedDiffPath(job.currentPath)
+		changedTiles, err := encodeChunkedDiff(fs, job.prevImg, job.currentImg, outPath, defaultTileSize)
+		if err != nil {
+			return fmt.Errorf("failed to write chunked diff for %s: %w", job.currentPath, err)
+		}
+		fmt.Printf("Chunked diff saved to %s (%d changed tiles)\n", outPath, changedTiles)
+		return nil
+	}
+
+	if bbox {
+		regions, err := writeBBoxDiff(fs, job.prevImg, job.currentImg, job.currentPath, threshold)
+		if err != nil {
+			return fmt.Errorf("failed to write bbox diff for %s: %w", job.currentPath, err)
+		}
+		fmt.Printf("Bbox diff for %s saved as %d region(s)\n", job.currentPath, regions)
+		return nil
+	}
+
+	fmt.Printf("Found %d different pixels between %s and %s.\n", job.diffPixels, job.prevPath, job.currentPath)
+
+	diffOutputName, err := generateOutputFilename(job.currentPath, "DIFF")
+	if err != nil {
+		return fmt.Errorf("error generating diff filename for %s: %w", job.currentPath, err)
+	}
+	outFile, err := fs.Create(diffOutputName)
+	if err != nil {
+		return fmt.Errorf("failed to create output file %s: %w", diffOutputName, err)
+	}
+	defer outFile.Close()
+	if err := png.Encode(outFile, job.diffImg); err != nil {
+		return fmt.Errorf("failed to encode difference image to PNG %s: %w", diffOutputName, err)
+	}
+	fmt.Printf("Difference image saved to %s\n", diffOutputName)
+
+	maskOutputName, err := generateOutputFilename(job.currentPath, "MASK")
+	if err != nil {
+		return fmt.Errorf("error generating mask filename for %s: %w", job.currentPath, err)
+	}
+	if err := saveMask(fs, maskOutputName, job.mask); err != nil {
+		return fmt.Errorf("failed to save mask %s: %w", maskOutputName, err)
+	}
+	fmt.Printf("Mask saved to %s\n", maskOutputName)
+	return nil
+}
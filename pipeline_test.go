@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func solidImage(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func writePNG(t *testing.T, fs FileSystem, name string, img image.Image) {
+	t.Helper()
+	f, err := fs.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunDiffModeWritesBaseDiffAndMask(t *testing.T) {
+	fs := newMemFS()
+	writePNG(t, fs, "f1.png", solidImage(4, 4, color.RGBA{1, 1, 1, 255}))
+	img2 := solidImage(4, 4, color.RGBA{1, 1, 1, 255})
+	img2.Set(0, 0, color.RGBA{200, 0, 0, 255})
+	writePNG(t, fs, "f2.png", img2)
+
+	runDiffMode(context.Background(), fs, []string{"f1.png", "f2.png"}, 2, 0, "png", false)
+
+	for _, want := range []string{"f1.BASE.png", "f2.DIFF.png", "f2.MASK.png"} {
+		if _, ok := fs.files[want]; !ok {
+			t.Errorf("expected %s to be written, it wasn't", want)
+		}
+	}
+}
+
+func TestLoadStageStopsOnCancelledContext(t *testing.T) {
+	fs := newMemFS()
+	writePNG(t, fs, "f1.png", solidImage(2, 2, color.RGBA{1, 1, 1, 255}))
+	writePNG(t, fs, "f2.png", solidImage(2, 2, color.RGBA{1, 1, 1, 255}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out := loadStage(ctx, fs, []string{"f1.png", "f2.png"}, 1)
+
+	select {
+	case _, ok := <-out:
+		if ok {
+			// A pair may have raced ahead of cancellation; draining below
+			// just needs to confirm the channel eventually closes.
+			for range out {
+			}
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("loadStage did not return promptly after ctx was cancelled")
+	}
+}
+
+func TestDiffStageClosesOutputAfterCancelWithNoConsumer(t *testing.T) {
+	img := solidImage(2, 2, color.RGBA{1, 1, 1, 255})
+	pair := framePair{index: 1, prevPath: "a.png", currentPath: "b.png", prevImg: img, currentImg: img}
+
+	in := make(chan framePair, 1)
+	in <- pair
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := diffStage(ctx, in, 1, 0, "png", false)
+	cancel() // a real consumer (encodeStage) would stop reading about now
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-out:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("diffStage did not close its output channel after ctx was cancelled with no consumer reading")
+		}
+	}
+}
+
+func TestPipelineDrainsPromptlyWhenCancelledMidFlight(t *testing.T) {
+	fs := newMemFS()
+	var paths []string
+	for i := range 6 {
+		name := fmt.Sprintf("f%d.png", i)
+		writePNG(t, fs, name, solidImage(4, 4, color.RGBA{uint8(i), 1, 1, 255}))
+		paths = append(paths, name)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pairs := loadStage(ctx, fs, paths, 1)
+	diffs := diffStage(ctx, pairs, 1, 0, "png", false)
+	results := encodeStage(ctx, fs, diffs, 1, len(paths)-1, 0, "png", false)
+
+	cancel() // simulate Ctrl-C while stages still have work queued
+
+	done := make(chan struct{})
+	go func() {
+		for range results {
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("pipeline did not drain and close after ctx was cancelled mid-flight")
+	}
+}